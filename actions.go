@@ -0,0 +1,231 @@
+package main
+
+// actions.go implements what happens to a confirmed duplicate group once it
+// has been found: the original "report" behavior (copy one representative
+// aside and write a list of its duplicates), plus space-reclaiming actions
+// that mutate the tree in place (hardlink, symlink, delete).
+//
+// Every mutating action re-stats each file immediately before touching it
+// and refuses to act if size or mtime has drifted since the scan, since the
+// scan and the action can be separated by an arbitrary amount of wall time.
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ActionMode selects what to do with a confirmed duplicate group.
+type ActionMode string
+
+const (
+	ActionReport   ActionMode = "report"
+	ActionHardlink ActionMode = "hardlink"
+	ActionSymlink  ActionMode = "symlink"
+	ActionDelete   ActionMode = "delete"
+)
+
+// CrossFSMode selects the hardlink fallback behavior when the canonical file
+// and a duplicate live on different filesystems.
+type CrossFSMode string
+
+const (
+	CrossFSSymlink CrossFSMode = "symlink"
+	CrossFSSkip    CrossFSMode = "skip"
+)
+
+// ActionOptions controls how confirmed duplicate groups are handled.
+type ActionOptions struct {
+	Mode          ActionMode
+	DryRun        bool
+	CrossFS       CrossFSMode
+	UniqFilesPath string
+	Print0        bool
+}
+
+// pickCanonical returns the file in a duplicate group with the latest
+// modification time, matching the selection logic the report mode has
+// always used.
+func pickCanonical(dupeFiles []map[string]interface{}) map[string]interface{} {
+	var latestFile map[string]interface{}
+	for _, file := range dupeFiles {
+		if latestFile == nil || file["mtime"].(time.Time).After(latestFile["mtime"].(time.Time)) {
+			latestFile = file
+		}
+	}
+	return latestFile
+}
+
+// staleCheck re-stats path and refuses to proceed if its size or mtime no
+// longer match what the scan observed.
+func staleCheck(path string, wantSize int64, wantMTime time.Time) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return fmt.Errorf("re-stat failed for %s: %w", path, err)
+	}
+	if info.Size() != wantSize || !info.ModTime().Equal(wantMTime) {
+		return fmt.Errorf("refusing to act on %s: size/mtime changed since scan", path)
+	}
+	return nil
+}
+
+// atomicReplaceWithLink creates a hardlink (or symlink) to target at a
+// temporary name beside dst, then renames it over dst. The rename is atomic
+// on the same filesystem, so dst is never observed in a half-replaced state.
+func atomicReplaceWithLink(dst, target string, symlink bool) error {
+	dir := filepath.Dir(dst)
+	tmp, err := os.CreateTemp(dir, ".dedupe-tmp-*")
+	if err != nil {
+		return fmt.Errorf("error reserving temp name in %s: %w", dir, err)
+	}
+	tmpName := tmp.Name()
+	tmp.Close()
+	if err := os.Remove(tmpName); err != nil {
+		return fmt.Errorf("error clearing reserved temp name %s: %w", tmpName, err)
+	}
+
+	if symlink {
+		err = os.Symlink(target, tmpName)
+	} else {
+		err = os.Link(target, tmpName)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpName, dst); err != nil {
+		os.Remove(tmpName)
+		return fmt.Errorf("error renaming %s over %s: %w", tmpName, dst, err)
+	}
+	return nil
+}
+
+// replaceWithLink replaces dupPath with a link to canonicalPath, hardlinking
+// by default and falling back to a symlink across filesystems according to
+// options.CrossFS.
+func replaceWithLink(dupPath, canonicalPath string, options ActionOptions) error {
+	err := atomicReplaceWithLink(dupPath, canonicalPath, false)
+	if err == nil {
+		log.Printf("hardlinked %s -> %s\n", dupPath, canonicalPath)
+		return nil
+	}
+
+	if !isCrossDeviceLinkError(err) {
+		return err
+	}
+
+	if options.CrossFS == CrossFSSkip {
+		log.Printf("skipping %s: on a different filesystem than %s\n", dupPath, canonicalPath)
+		return nil
+	}
+
+	if err := atomicReplaceWithLink(dupPath, canonicalPath, true); err != nil {
+		return err
+	}
+	log.Printf("symlinked %s -> %s (cross-filesystem fallback)\n", dupPath, canonicalPath)
+	return nil
+}
+
+// applyAction handles one confirmed duplicate group (all files sharing the
+// same size+hash key) according to options.Mode.
+func applyAction(dupeFiles []map[string]interface{}, options ActionOptions) {
+	canonical := pickCanonical(dupeFiles)
+	if canonical == nil {
+		return
+	}
+	canonicalPath := canonical["name"].(string)
+
+	if options.Mode == ActionReport {
+		reportDuplicateGroup(dupeFiles, canonical, options.UniqFilesPath, options.Print0)
+		return
+	}
+
+	for _, file := range dupeFiles {
+		path := file["name"].(string)
+		if path == canonicalPath {
+			continue
+		}
+
+		size := file["size"].(int64)
+		mtime := file["mtime"].(time.Time)
+
+		applyActionToPath(path, size, mtime, canonicalPath, options)
+
+		// path's aliases are other names for the exact same physical file
+		// (same device+inode). They must be relinked/deleted right along
+		// with path itself; otherwise they keep path's old inode alive as
+		// its own standalone blob and no space is actually reclaimed.
+		aliases, _ := file["aliases"].([]string)
+		for _, alias := range aliases {
+			applyActionToPath(alias, size, mtime, canonicalPath, options)
+		}
+	}
+}
+
+// applyActionToPath applies options.Mode to a single path known to carry
+// the given size/mtime, relative to canonicalPath. It's called once for a
+// duplicate group member and again for each of that member's aliases.
+func applyActionToPath(path string, size int64, mtime time.Time, canonicalPath string, options ActionOptions) {
+	if err := staleCheck(path, size, mtime); err != nil {
+		log.Printf("%s\n", err)
+		return
+	}
+
+	switch options.Mode {
+	case ActionHardlink:
+		if options.DryRun {
+			log.Printf("[dry-run] would hardlink %s -> %s\n", path, canonicalPath)
+			return
+		}
+		if err := replaceWithLink(path, canonicalPath, options); err != nil {
+			log.Printf("error hardlinking %s: %s\n", path, err.Error())
+		}
+
+	case ActionSymlink:
+		if options.DryRun {
+			log.Printf("[dry-run] would symlink %s -> %s\n", path, canonicalPath)
+			return
+		}
+		if err := atomicReplaceWithLink(path, canonicalPath, true); err != nil {
+			log.Printf("error symlinking %s: %s\n", path, err.Error())
+			return
+		}
+		log.Printf("symlinked %s -> %s\n", path, canonicalPath)
+
+	case ActionDelete:
+		if options.DryRun {
+			log.Printf("[dry-run] would delete %s\n", path)
+			return
+		}
+		if err := os.Remove(path); err != nil {
+			log.Printf("error deleting %s: %s\n", path, err.Error())
+			return
+		}
+		log.Printf("deleted %s\n", path)
+	}
+}
+
+// reportDuplicateGroup preserves the original behavior: copy the canonical
+// file aside to UniqFilesPath and write a list of its duplicates next to it.
+func reportDuplicateGroup(dupeFiles []map[string]interface{}, canonical map[string]interface{}, uniqFilesPath string, print0 bool) {
+	canonicalPath := canonical["name"].(string)
+	baseDstPath := filepath.Join(uniqFilesPath, filepath.Base(canonicalPath))
+
+	uniqFilePath := getUniqueFilePath(baseDstPath)
+	if uniqFilePath != baseDstPath {
+		log.Printf("File %s already exists, using %s instead\n",
+			filepath.Base(baseDstPath), filepath.Base(uniqFilePath))
+	}
+
+	if err := copyFile(canonicalPath, uniqFilePath); err != nil {
+		log.Printf("%s\n", err)
+		return
+	}
+
+	dupListFilePath := uniqFilePath + "-dup-list.txt"
+	if err := writeDuplicateList(dupeFiles, canonicalPath, dupListFilePath, print0); err != nil {
+		log.Printf("%s\n", err)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func mustLstat(t *testing.T, path string) os.FileInfo {
+	t.Helper()
+	info, err := os.Lstat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info
+}
+
+func TestStaleCheck(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.txt")
+	if err := os.WriteFile(path, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	info := mustLstat(t, path)
+
+	if err := staleCheck(path, info.Size(), info.ModTime()); err != nil {
+		t.Errorf("staleCheck on an unmodified file returned an error: %s", err)
+	}
+
+	// Drift the file's size (and mtime) after the scan observed it.
+	if err := os.WriteFile(path, []byte("hello world"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := staleCheck(path, info.Size(), info.ModTime()); err == nil {
+		t.Error("staleCheck did not refuse a file whose size/mtime drifted since the scan")
+	}
+}
+
+// TestAtomicReplaceWithLinkLeavesNoHalfState checks that a failed link
+// attempt (target doesn't exist) never touches dst, and never leaves a
+// reserved temp name behind.
+func TestAtomicReplaceWithLinkLeavesNoHalfState(t *testing.T) {
+	dir := t.TempDir()
+	dst := filepath.Join(dir, "dst.txt")
+	if err := os.WriteFile(dst, []byte("original"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	missingTarget := filepath.Join(dir, "does-not-exist.txt")
+	if err := atomicReplaceWithLink(dst, missingTarget, false); err == nil {
+		t.Fatal("expected an error linking to a nonexistent target")
+	}
+
+	contents, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatalf("dst disappeared after a failed link attempt: %s", err)
+	}
+	if string(contents) != "original" {
+		t.Errorf("dst was left in a half-replaced state: got %q", contents)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if e.Name() != "dst.txt" {
+			t.Errorf("unexpected leftover file after a failed link: %s", e.Name())
+		}
+	}
+}
+
+// TestApplyActionRelinksAliases reproduces the bug fixed in 08fd621: a
+// duplicate group member with aliases (other names for the same physical
+// file) must have every alias relinked alongside it, or the alias keeps the
+// old inode alive and no space is actually reclaimed.
+func TestApplyActionRelinksAliases(t *testing.T) {
+	dir := t.TempDir()
+	aPath := filepath.Join(dir, "a.txt")
+	aliasPath := filepath.Join(dir, "a2.txt")
+	bPath := filepath.Join(dir, "b.txt")
+
+	if err := os.WriteFile(aPath, []byte("dup"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(aPath, aliasPath); err != nil {
+		t.Skipf("hardlinks unsupported on this filesystem: %s", err)
+	}
+	if err := os.WriteFile(bPath, []byte("dup"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	aInfo := mustLstat(t, aPath)
+
+	// Give b the later mtime so pickCanonical picks it, leaving a (and its
+	// alias) as the member applyAction should act on.
+	later := aInfo.ModTime().Add(time.Minute)
+	if err := os.Chtimes(bPath, later, later); err != nil {
+		t.Fatal(err)
+	}
+	bInfo := mustLstat(t, bPath)
+
+	dupeFiles := []map[string]interface{}{
+		{"name": bPath, "size": bInfo.Size(), "mtime": bInfo.ModTime(), "aliases": []string(nil)},
+		{"name": aPath, "size": aInfo.Size(), "mtime": aInfo.ModTime(), "aliases": []string{aliasPath}},
+	}
+
+	applyAction(dupeFiles, ActionOptions{Mode: ActionHardlink})
+
+	aDev, aIno, aOk := fileIdentity(mustLstat(t, aPath))
+	aliasDev, aliasIno, aliasOk := fileIdentity(mustLstat(t, aliasPath))
+	bDev, bIno, bOk := fileIdentity(mustLstat(t, bPath))
+	if !aOk || !aliasOk || !bOk {
+		t.Skip("platform has no stable (device, inode) identity to compare")
+	}
+
+	if aDev != bDev || aIno != bIno {
+		t.Error("a.txt was not relinked to b.txt's inode")
+	}
+	if aliasDev != bDev || aliasIno != bIno {
+		t.Error("a.txt's alias was not relinked alongside it")
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package main
+
+// isCrossDeviceLinkError has no portable cross-device errno to check on
+// this platform (e.g. plan9), so replaceWithLink never takes the symlink
+// fallback path here and a cross-device os.Link failure is just reported
+// as an ordinary hardlink error.
+func isCrossDeviceLinkError(err error) bool {
+	return false
+}
@@ -0,0 +1,15 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"syscall"
+)
+
+// isCrossDeviceLinkError reports whether err is the "invalid cross-device
+// link" error os.Link returns when target and dst are on different
+// filesystems.
+func isCrossDeviceLinkError(err error) bool {
+	return errors.Is(err, syscall.EXDEV)
+}
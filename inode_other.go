@@ -0,0 +1,12 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// fileIdentity has no stable (device, inode) pair to report on this
+// platform (e.g. Windows, plan9), so every path is treated as its own
+// physical file.
+func fileIdentity(info os.FileInfo) (dev uint64, ino uint64, ok bool) {
+	return 0, 0, false
+}
@@ -0,0 +1,19 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileIdentity returns the (device, inode) pair identifying the on-disk
+// blob backing info, when the platform exposes one. Two paths that return
+// the same (dev, ino) are the same physical file.
+func fileIdentity(info os.FileInfo) (dev uint64, ino uint64, ok bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return uint64(stat.Dev), uint64(stat.Ino), true
+}
@@ -0,0 +1,100 @@
+// Package metrics tracks how much work a scan avoided doing, and how much
+// disk space its confirmed duplicate groups could reclaim.
+package metrics
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Metrics accumulates atomic counters describing one scan run: how many
+// files were considered, ignored, or empty; how many bytes were read at the
+// sample and full-hash stages; how many files were eliminated as unique at
+// each pipeline stage (by size, by sample, by full hash); and how many bytes
+// confirmed duplicate groups could reclaim. All counter fields are updated
+// with atomic ops so concurrent scan workers can share a single Metrics.
+type Metrics struct {
+	FilesConsidered    int64
+	FilesIgnored       int64
+	FilesEmpty         int64
+	BytesConsidered    int64
+	BytesHashed        int64
+	EliminatedBySize   int64
+	EliminatedBySample int64
+	EliminatedByHash   int64
+	RedundantBytes     int64
+
+	mu     sync.Mutex
+	phases map[string]time.Duration
+}
+
+// New returns a ready-to-use Metrics.
+func New() *Metrics {
+	return &Metrics{phases: make(map[string]time.Duration)}
+}
+
+func (m *Metrics) AddFilesConsidered(n int64)    { atomic.AddInt64(&m.FilesConsidered, n) }
+func (m *Metrics) AddFilesIgnored(n int64)       { atomic.AddInt64(&m.FilesIgnored, n) }
+func (m *Metrics) AddFilesEmpty(n int64)         { atomic.AddInt64(&m.FilesEmpty, n) }
+func (m *Metrics) AddBytesConsidered(n int64)    { atomic.AddInt64(&m.BytesConsidered, n) }
+func (m *Metrics) AddBytesHashed(n int64)        { atomic.AddInt64(&m.BytesHashed, n) }
+func (m *Metrics) AddEliminatedBySize(n int64)   { atomic.AddInt64(&m.EliminatedBySize, n) }
+func (m *Metrics) AddEliminatedBySample(n int64) { atomic.AddInt64(&m.EliminatedBySample, n) }
+func (m *Metrics) AddEliminatedByHash(n int64)   { atomic.AddInt64(&m.EliminatedByHash, n) }
+func (m *Metrics) AddRedundantBytes(n int64)     { atomic.AddInt64(&m.RedundantBytes, n) }
+
+// RecordPhase stores how long a named pipeline phase took.
+func (m *Metrics) RecordPhase(name string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.phases[name] = d
+}
+
+// Phases returns a snapshot of all recorded phase durations.
+func (m *Metrics) Phases() map[string]time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	out := make(map[string]time.Duration, len(m.phases))
+	for name, d := range m.phases {
+		out[name] = d
+	}
+	return out
+}
+
+// Snapshot is a point-in-time, JSON-friendly view of a Metrics.
+type Snapshot struct {
+	FilesConsidered    int64            `json:"files_considered"`
+	FilesIgnored       int64            `json:"files_ignored"`
+	FilesEmpty         int64            `json:"files_empty"`
+	BytesConsidered    int64            `json:"bytes_considered"`
+	BytesHashed        int64            `json:"bytes_hashed"`
+	EliminatedBySize   int64            `json:"eliminated_unique_size"`
+	EliminatedBySample int64            `json:"eliminated_unique_sample"`
+	EliminatedByHash   int64            `json:"eliminated_unique_hash"`
+	RedundantBytes     int64            `json:"redundant_bytes"`
+	PhaseMillis        map[string]int64 `json:"phase_millis"`
+}
+
+// Snapshot captures the current counter values and phase durations.
+func (m *Metrics) Snapshot() Snapshot {
+	phases := m.Phases()
+	phaseMillis := make(map[string]int64, len(phases))
+	for name, d := range phases {
+		phaseMillis[name] = d.Milliseconds()
+	}
+
+	return Snapshot{
+		FilesConsidered:    atomic.LoadInt64(&m.FilesConsidered),
+		FilesIgnored:       atomic.LoadInt64(&m.FilesIgnored),
+		FilesEmpty:         atomic.LoadInt64(&m.FilesEmpty),
+		BytesConsidered:    atomic.LoadInt64(&m.BytesConsidered),
+		BytesHashed:        atomic.LoadInt64(&m.BytesHashed),
+		EliminatedBySize:   atomic.LoadInt64(&m.EliminatedBySize),
+		EliminatedBySample: atomic.LoadInt64(&m.EliminatedBySample),
+		EliminatedByHash:   atomic.LoadInt64(&m.EliminatedByHash),
+		RedundantBytes:     atomic.LoadInt64(&m.RedundantBytes),
+		PhaseMillis:        phaseMillis,
+	}
+}
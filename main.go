@@ -1,24 +1,16 @@
 package main
 
 // Package main implements a command line tool to identify duplicate files based on
-// size and MD5 hash value. It provides options to limit the maximum file size for
-// MD5 calculation and the frequency of status messages.
-//
-// ScanOptions defines the maximum file size to calculate the MD5 hash, the frequency
-// to print a status message, and the maximum length of the MD5 calculation queue.
-//
-// scanFiles scans the specified directory for files, calculates their MD5 hash, and
-// identifies duplicate files. It returns a dictionary of files, a list of duplicates,
-// zero-length files, and files that exceed the maximum size.
-//
-// getMD5Hash calculates the MD5 hash of a given file and returns it as a string.
+// size and content hash. Rather than hashing every file end-to-end, it runs a
+// three-phase pipeline (see scan.go): bucket by size, sub-bucket by a small content
+// sample, and only then compute a full hash of the survivors. This lets it skip
+// reading most bytes of a tree dominated by unique files.
 //
 // The main function parses command line flags, sets up scan options, and initiates
 // the file scanning process. It prints the results, including duplicate files,
 // zero-length files, and oversized files, and displays the total run time.
 
 import (
-	"crypto/md5"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -27,31 +19,10 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
-	"sync"
 	"time"
-)
 
-type ScanOptions struct {
-	MaxMB          int
-	Detail         int
-	MaxQueueLength int
-	RegExes        []*regexp.Regexp
-}
-
-// matchesRegexFilters checks if a file matches any of the provided regex filters
-// If no filters are provided, it returns true
-func matchesRegexFilters(filename string, regexes []*regexp.Regexp) bool {
-	if len(regexes) == 0 {
-		return true
-	}
-	
-	for _, re := range regexes {
-		if re.MatchString(filepath.Base(filename)) {
-			return true
-		}
-	}
-	return false
-}
+	"github.com/tubalcaine/go-dedupe/internal/metrics"
+)
 
 // getUniqueFilePath returns a unique file path by adding a numeric suffix if needed
 func getUniqueFilePath(basePath string) string {
@@ -114,217 +85,38 @@ func copyFile(src, dst string) error {
 	return nil
 }
 
-// writeDuplicateList writes a list of duplicate files to the specified path, excluding the original file
-func writeDuplicateList(files []map[string]interface{}, originalFile, listPath string) error {
+// writeDuplicateList writes a list of duplicate files to the specified path, excluding the original file.
+// Under print0, entries are NUL-terminated instead of newline-terminated, so the list stays
+// safe to pipe into xargs -0 even when a path contains an embedded newline.
+func writeDuplicateList(files []map[string]interface{}, originalFile, listPath string, print0 bool) error {
 	// Handle path collisions by creating a unique file path
 	uniqueListPath := getUniqueFilePath(listPath)
-	
+
 	// Create the duplicate list file
 	dupListFile, err := os.Create(uniqueListPath)
 	if err != nil {
 		return fmt.Errorf("error creating duplicate list file %s: %w", uniqueListPath, err)
 	}
 	defer dupListFile.Close() // This will close when the function returns
-	
+
+	terminator := "\n"
+	if print0 {
+		terminator = "\x00"
+	}
+
 	// Write all duplicate files except the original to the list
 	for _, file := range files {
 		if file["name"].(string) != originalFile {
-			fmt.Fprintf(dupListFile, "%s\n", file["name"].(string))
+			fmt.Fprintf(dupListFile, "%s%s", file["name"].(string), terminator)
 		}
 	}
-	
+
 	// Log if we had to use a different path
 	if uniqueListPath != listPath {
 		log.Printf("Duplicate list file already exists, created %s instead\n", uniqueListPath)
 	}
-	
-	return nil
-}
-
-func scanFiles(path string, options ScanOptions, totalCount int) (map[string][]map[string]interface{}, map[string]bool, []string, []string) {
-	duplicateList := make(map[string]bool)
-	fileDict := make(map[string][]map[string]interface{})
-	zeroLengthFiles := make([]string, 0, 100)  // Pre-allocate capacity
-	largeFiles := make([]string, 0, 100)       // Pre-allocate capacity
-
-	count := 0
-	var mu sync.Mutex
-	var wg sync.WaitGroup
-	md5Queue := make(chan struct{}, options.MaxQueueLength)
-
-	// Create a buffer pool to reduce GC pressure
-	bufferPool := sync.Pool{
-		New: func() interface{} {
-			// 4MB buffer for file reads
-			return make([]byte, 4*1024*1024)
-		},
-	}
-
-	err := filepath.Walk(path, func(filePath string, info os.FileInfo, err error) error {
-		if err != nil {
-			log.Printf("Error accessing file: %s\n", filePath)
-			log.Printf("Error: %s\n", err.Error())
-			return nil
-		}
-
-		if !info.Mode().IsRegular() {
-			return nil
-		}
-
-		if !matchesRegexFilters(filePath, options.RegExes) {
-			return nil
-		}
-
-		count++
-		if options.Detail > 0 && count%options.Detail == 0 {
-			if totalCount > 0 {
-				percentComplete := float64(count) / float64(totalCount) * 100
-				log.Printf("Processed %d of %d files (%.2f%%).\t%s\r", count, totalCount, percentComplete, filepath.Dir(filePath))
-			} else {
-				log.Printf("Processed %d files.\t%s\r", count, filepath.Dir(filePath))
-			}
-		}
-
-		fileSize := info.Size()
-
-		// Skip empty files
-		if fileSize == 0 {
-			mu.Lock()
-			zeroLengthFiles = append(zeroLengthFiles, filePath)
-			mu.Unlock()
-			return nil
-		}
-
-		// Skip large files
-		if int64(options.MaxMB) > 0 && fileSize > int64(options.MaxMB)*1024*1024 {
-			log.Printf("Skipping VERY large %.2fMB file: %s\n", float64(fileSize)/(1024*1024), filePath)
-			mu.Lock()
-			largeFiles = append(largeFiles, filePath)
-			mu.Unlock()
-			return nil
-		}
-
-		// Warn of files larger than 4GB
-		if fileSize > 4*1024*1024*1024 {
-			fmt.Fprintf(os.Stderr, "Processing large (%.2f MB) file: %s\n", float64(fileSize)/(1024*1024), filePath)
-		}
-
-		wg.Add(1)
-		md5Queue <- struct{}{} // Add to the queue
-
-		go func(filePath string, fileSize int64, modTime time.Time) {
-			defer wg.Done()
-			defer func() { <-md5Queue }() // Remove from the queue
-
-			startTime := time.Now()
-
-			// Use custom MD5 calculation with buffer from pool
-			file, err := os.Open(filePath)
-			var fileHash string
-			
-			if err != nil {
-				log.Printf("\nError opening file: %s\n", filePath)
-				log.Printf("Exception: %s\n", err.Error())
-				fileHash = "00000000000000000000000000000000"
-			} else {
-				defer file.Close()
-				
-				// Get a buffer from the pool
-				buf := bufferPool.Get().([]byte)
-				defer bufferPool.Put(buf) // Return the buffer to the pool
-				
-				hash := md5.New()
-				
-				// Read file in chunks
-				for {
-					n, err := file.Read(buf)
-					if n > 0 {
-						hash.Write(buf[:n])
-					}
-					if err == io.EOF {
-						break
-					}
-					if err != nil {
-						log.Printf("\nError reading file: %s\n", filePath)
-						log.Printf("Exception: %s\n", err.Error())
-						fileHash = "00000000000000000000000000000000"
-						break
-					}
-				}
-				
-				if fileHash == "" {
-					fileHash = fmt.Sprintf("%x", hash.Sum(nil))
-				}
-			}
-
-			elapsedTime := time.Since(startTime)
-
-			if fileSize > 4*1024*1024*1024 {
-				log.Printf("File processed in %s\n\n", elapsedTime)
-			}
-
-			key := fmt.Sprintf("%d:%s", fileSize, fileHash)
-			fileInfo := map[string]interface{}{
-				"name":     filePath,
-				"size":     fileSize,
-				"md5_hash": fileHash,
-				"key":      key,
-				"mtime":    modTime,
-			}
-
-			mu.Lock()
-			defer mu.Unlock()
-
-			if fileHash != "00000000000000000000000000000000" {
-				if _, ok := fileDict[key]; ok {
-					fileDict[key] = append(fileDict[key], fileInfo)
-					duplicateList[key] = true
-				} else {
-					fileDict[key] = []map[string]interface{}{fileInfo}
-				}
-			}
-		}(filePath, fileSize, info.ModTime())
-
-		return nil
-	})
-
-	wg.Wait() // Wait for all goroutines to finish
-
-	if err != nil {
-		log.Printf("Error scanning files: %s\n", err.Error())
-	}
-
-	return fileDict, duplicateList, zeroLengthFiles, largeFiles
-}
-
-func countFiles(path string, options ScanOptions) (int, error) {
-	count := 0
-	detail := options.Detail
-	totalCount := 0
-
-	err := filepath.Walk(path, func(filePath string, info os.FileInfo, err error) error {
-		// Make errors non-fatal in counting mode
-		if err != nil {
-			log.Printf("Error accessing file: %s\nError: %s\n", filePath, err.Error())
-			//			return err
-			return nil
-		}
-
-		if info.Mode().IsRegular() {
-			totalCount++
-
-			if detail > 0 && totalCount%detail == 0 {
-				log.Printf("Counted %d files of which %d matched a regex.\n Currently in dir %s.\n",
-					totalCount, count, filepath.Dir(filePath))
-			}
 
-			if matchesRegexFilters(filePath, options.RegExes) {
-				count++
-			}
-		}
-		return nil
-	})
-	return count, err
+	return nil
 }
 
 func main() {
@@ -333,11 +125,19 @@ func main() {
 	// Define command line flags
 	detail := flag.Int("detail", 77, "Set how often to print a status message")
 	maxMB := flag.Int("maxmb", 0, "Set the maximum file size in megabytes (default 0 for no limit)")
-	maxQueueLength := flag.Int("maxQueueLength", 5, "Set the maximum number of concurrent MD5 calculations")
+	maxQueueLength := flag.Int("maxQueueLength", 5, "Set the maximum number of concurrent hash calculations")
+	sampleSize := flag.Int64("sampleSize", DefaultSampleSize, "Set the sample size in bytes used to pre-filter size-collisions before full hashing")
 	path := flag.String("path", ".", "Set the path to scan")
 	precount := flag.Bool("precount", false, "Pre-count the total number of files before scanning")
 	jsonOutput := flag.String("json", "", "Set the file path to save the scan results in JSON format")
 	uniqFilesPath := flag.String("uniqFilesPath", "", "Set the dir/folder to save one unique file of each set of duplicates")
+	action := flag.String("action", string(ActionReport), "Set what to do with confirmed duplicates: report, hardlink, symlink, or delete")
+	dryRun := flag.Bool("dry-run", false, "Log the mutations an action would make without performing them")
+	crossFS := flag.String("cross-fs", string(CrossFSSymlink), "Set the hardlink fallback across filesystems: symlink or skip")
+	hashAlgo := flag.String("hash", string(DefaultHashAlgo), "Set the content hash algorithm: md5, sha256, or blake2b")
+	verify := flag.Bool("verify", false, "Byte-by-byte verify each duplicate group before acting on it")
+	fromStdin := flag.Bool("from-stdin", false, "Read newline- or NUL-delimited file paths from stdin instead of walking -path")
+	print0 := flag.Bool("print0", false, "NUL-terminate duplicate report and unique-file list output instead of newline-terminating it, for piping into xargs -0")
 
 	var regexList []string
 
@@ -347,6 +147,26 @@ func main() {
 	})
 
 	flag.Parse()
+
+	actionMode := ActionMode(*action)
+	switch actionMode {
+	case ActionReport, ActionHardlink, ActionSymlink, ActionDelete:
+	default:
+		log.Fatalf("Invalid -action %q: must be report, hardlink, symlink, or delete\n", *action)
+	}
+
+	crossFSMode := CrossFSMode(*crossFS)
+	switch crossFSMode {
+	case CrossFSSymlink, CrossFSSkip:
+	default:
+		log.Fatalf("Invalid -cross-fs %q: must be symlink or skip\n", *crossFS)
+	}
+
+	hasher, err := NewHasher(HashAlgo(*hashAlgo))
+	if err != nil {
+		log.Fatalf("%s\n", err.Error())
+	}
+
 	if *uniqFilesPath != "" {
 		err := os.MkdirAll(*uniqFilesPath, os.ModePerm)
 		if err != nil {
@@ -365,11 +185,20 @@ func main() {
 
 	var totalCount int
 
+	m := metrics.New()
+
 	options := ScanOptions{
 		MaxMB:          *maxMB,
 		Detail:         *detail,
 		MaxQueueLength: *maxQueueLength,
+		SampleSize:     *sampleSize,
+		Hasher:         hasher,
 		RegExes:        compiledRegexes,
+		Metrics:        m,
+	}
+
+	if *fromStdin && *precount {
+		log.Fatalf("-precount requires a directory walk and can't be combined with -from-stdin\n")
 	}
 
 	if *precount {
@@ -381,14 +210,70 @@ func main() {
 		fmt.Printf("Total number of files to scan: %d\n", totalCount)
 	}
 
-	fileDict, duplicateList, zeroLengthFiles, oversizeFiles := scanFiles(*path, options, totalCount)
+	var fileDict map[string][]map[string]interface{}
+	var duplicateList map[string]bool
+	var zeroLengthFiles, oversizeFiles []string
+	var aliasGroups []aliasGroup
+
+	if *fromStdin {
+		fileDict, duplicateList, zeroLengthFiles, oversizeFiles, aliasGroups = scanFilesFromStdin(os.Stdin, options)
+	} else {
+		fileDict, duplicateList, zeroLengthFiles, oversizeFiles, aliasGroups = scanFiles(*path, options, totalCount)
+	}
+
+	// reportOut carries descriptive, human-readable output. Under -print0 it's
+	// redirected to stderr so the report below writes nothing but
+	// NUL-terminated paths to stdout, safe to pipe into xargs -0. The
+	// -precount line printed above still goes to stdout.
+	var reportOut io.Writer = os.Stdout
+	if *print0 {
+		reportOut = os.Stderr
+	}
+
+	actionOptions := ActionOptions{
+		Mode:          actionMode,
+		DryRun:        *dryRun,
+		CrossFS:       crossFSMode,
+		UniqFilesPath: *uniqFilesPath,
+		Print0:        *print0,
+	}
+
+	actionStart := time.Now()
+
+	for dupe := range duplicateList {
+		dupeFiles := fileDict[dupe]
+
+		if *verify {
+			dupeFiles = verifyDuplicateGroup(dupeFiles)
+			fileDict[dupe] = dupeFiles
+			if len(dupeFiles) < 2 {
+				delete(duplicateList, dupe)
+				continue
+			}
+		}
+
+		fmt.Fprintf(reportOut, "Duplicate files found for %s:\n", dupe)
+		if *print0 {
+			for _, file := range dupeFiles {
+				fmt.Printf("%s\x00", file["name"].(string))
+			}
+		}
+		if len(dupeFiles) > 0 {
+			applyAction(dupeFiles, actionOptions)
+		}
+	}
+
+	m.RecordPhase("action", time.Since(actionStart))
+
 	if *jsonOutput != "" {
 		output := map[string]interface{}{
 			"fileDict":        fileDict,
 			"duplicateList":   duplicateList,
 			"zeroLengthFiles": zeroLengthFiles,
 			"oversizeFiles":   oversizeFiles,
+			"aliasGroups":     aliasGroups,
 			"maxMB":           *maxMB,
+			"metrics":         m.Snapshot(),
 		}
 
 		file, err := os.Create(*jsonOutput)
@@ -404,57 +289,50 @@ func main() {
 		}
 	}
 
-	for dupe := range duplicateList {
-		fmt.Printf("Duplicate files found for %s:\n", dupe)
-		dupeFiles := fileDict[dupe]
-		if len(dupeFiles) > 0 {
-			// Find the file with the latest modification time
-			var latestFile map[string]interface{}
-			for _, file := range dupeFiles {
-				if latestFile == nil || file["mtime"].(time.Time).After(latestFile["mtime"].(time.Time)) {
-					latestFile = file
-				}
-			}
-			firstFile := latestFile["name"].(string)
-			baseDstPath := filepath.Join(*uniqFilesPath, filepath.Base(firstFile))
-			
-			// Handle file name collisions
-			uniqFilePath := getUniqueFilePath(baseDstPath)
-			
-			// Log if we had to use a different path than expected
-			if uniqFilePath != baseDstPath {
-				log.Printf("File %s already exists, using %s instead\n", 
-					filepath.Base(baseDstPath), filepath.Base(uniqFilePath))
-			}
-
-			// Copy the file with the latest modification time to the unique file path
-			if err := copyFile(firstFile, uniqFilePath); err != nil {
-				log.Printf("%s\n", err)
-				continue
-			}
+	fmt.Fprintln(reportOut, "\nZero length files:")
 
-			// Create the duplicate list file
-			dupListFilePath := uniqFilePath + "-dup-list.txt"
-			if err := writeDuplicateList(dupeFiles, firstFile, dupListFilePath); err != nil {
-				log.Printf("%s\n", err)
-			}
+	for _, file := range zeroLengthFiles {
+		if *print0 {
+			fmt.Printf("%s\x00", file)
+		} else {
+			fmt.Fprintf(reportOut, "  %s\n", file)
 		}
 	}
 
-	fmt.Println("\nZero length files:")
+	fmt.Fprintln(reportOut, "\nOversize files:")
 
-	for _, file := range zeroLengthFiles {
-		fmt.Printf("  %s\n", file)
+	for _, file := range oversizeFiles {
+		if *print0 {
+			fmt.Printf("%s\x00", file)
+		} else {
+			fmt.Fprintf(reportOut, "  %s\n", file)
+		}
 	}
 
-	fmt.Println("\nOversize files:")
+	if len(aliasGroups) > 0 {
+		fmt.Fprintln(reportOut, "\nAliases of one physical file (already hardlinked, nothing to reclaim):")
 
-	for _, file := range oversizeFiles {
-		fmt.Printf("  %s\n", file)
+		for _, group := range aliasGroups {
+			fmt.Fprintf(reportOut, "  %s\n", group.Canonical)
+			for _, alias := range group.Aliases {
+				fmt.Fprintf(reportOut, "    = %s\n", alias)
+			}
+		}
+	}
+
+	snap := m.Snapshot()
+	fmt.Fprintln(reportOut, "\nScan summary:")
+	fmt.Fprintf(reportOut, "  Files considered: %d (ignored %d, empty %d)\n", snap.FilesConsidered, snap.FilesIgnored, snap.FilesEmpty)
+	fmt.Fprintf(reportOut, "  Eliminated as unique: %d by size, %d by sample, %d by full hash\n",
+		snap.EliminatedBySize, snap.EliminatedBySample, snap.EliminatedByHash)
+	fmt.Fprintf(reportOut, "  Bytes considered: %d, bytes hashed: %d\n", snap.BytesConsidered, snap.BytesHashed)
+	fmt.Fprintf(reportOut, "  Reclaimable space: %.2f MB\n", float64(snap.RedundantBytes)/(1024*1024))
+	for name, ms := range snap.PhaseMillis {
+		fmt.Fprintf(reportOut, "  Phase %q: %dms\n", name, ms)
 	}
 
-	fmt.Println("\nDone.")
+	fmt.Fprintln(reportOut, "\nDone.")
 
 	elapsedTime := time.Since(startTime)
-	fmt.Printf("Total run time: %s\n", elapsedTime)
+	fmt.Fprintf(reportOut, "Total run time: %s\n", elapsedTime)
 }
\ No newline at end of file
@@ -0,0 +1,604 @@
+package main
+
+// scan.go implements the multi-stage scanning pipeline used to find duplicate
+// files without reading the full contents of files that are obviously unique.
+//
+// Phase 1 (bucketBySize) walks the tree and groups files by size alone. Any
+// size bucket with exactly one member is unique by definition and is never
+// opened. bucketBySizeFromPaths is an alternate Phase 1 entry point that
+// reads the candidate paths from a stream (e.g. stdin) instead of walking a
+// directory, for use with -from-stdin.
+//
+// Phase 2 (bucketBySample) reads a small, fixed-size sample of each surviving
+// candidate (the first SampleSize bytes, or head+middle+tail for files much
+// larger than the sample) and groups by (size, sample hash). Singletons are
+// again discarded without a full read.
+//
+// Phase 3 (bucketByFullHash) computes a full content hash for the remaining
+// candidates and produces the final duplicate groups.
+//
+// Phases 2 and 3 share the same concurrency controls (MaxQueueLength, a
+// pooled read buffer) so the pipeline doesn't trade I/O savings for
+// goroutine or memory blowup; Phase 1 runs on the calling goroutine.
+
+import (
+	"bufio"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/tubalcaine/go-dedupe/internal/metrics"
+)
+
+// DefaultSampleSize is used when -sampleSize is zero or unset.
+const DefaultSampleSize = 4 * 1024
+
+type ScanOptions struct {
+	MaxMB          int
+	Detail         int
+	MaxQueueLength int
+	SampleSize     int64
+	Hasher         Hasher
+	RegExes        []*regexp.Regexp
+	Metrics        *metrics.Metrics
+}
+
+// candidate carries the metadata we need to carry a file through the
+// pipeline without re-statting it at every phase. aliases holds other paths
+// that share the same (device, inode) as path, i.e. are already the same
+// physical file on disk rather than a separate copy.
+type candidate struct {
+	path    string
+	size    int64
+	modTime time.Time
+	aliases []string
+}
+
+// identityKey identifies a physical file by (device, inode) so hardlinked
+// paths can be collapsed into one candidate before any hashing happens.
+type identityKey struct {
+	dev uint64
+	ino uint64
+}
+
+// aliasGroup reports a set of paths that are already the same physical file
+// on disk (shared device+inode), as opposed to duplicate but distinct files.
+type aliasGroup struct {
+	Canonical string
+	Aliases   []string
+}
+
+// matchesRegexFilters checks if a file matches any of the provided regex filters
+// If no filters are provided, it returns true
+func matchesRegexFilters(filename string, regexes []*regexp.Regexp) bool {
+	if len(regexes) == 0 {
+		return true
+	}
+
+	for _, re := range regexes {
+		if re.MatchString(filepath.Base(filename)) {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultBufferSize is the chunk size fullHash streams through.
+const defaultBufferSize = 4 * 1024 * 1024
+
+// newBufferPool returns a sync.Pool of size-byte read buffers, shared by a
+// phase's worker goroutines to keep GC pressure down.
+func newBufferPool(size int) *sync.Pool {
+	return &sync.Pool{
+		New: func() interface{} {
+			return make([]byte, size)
+		},
+	}
+}
+
+// hashReader streams r through h using a buffer from pool, returning the
+// number of bytes copied.
+func hashReader(h hash.Hash, r io.Reader, pool *sync.Pool) (int64, error) {
+	buf := pool.Get().([]byte)
+	defer pool.Put(buf)
+
+	var total int64
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			h.Write(buf[:n])
+			total += int64(n)
+		}
+		if err == io.EOF {
+			return total, nil
+		}
+		if err != nil {
+			return total, err
+		}
+	}
+}
+
+// sampleHash hashes a representative sample of a file: the first SampleSize
+// bytes for small files, or head+middle+tail slices for files large enough
+// that a single slice wouldn't be representative. It returns the hash along
+// with the number of bytes actually read, since that can be less than
+// SampleSize for small files and is a multiple of it for large ones.
+func sampleHash(path string, size int64, sampleSize int64, pool *sync.Pool, hasher Hasher) (string, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+
+	h := hasher.New()
+	buf := pool.Get().([]byte)
+	defer pool.Put(buf)
+	if int64(len(buf)) > sampleSize {
+		buf = buf[:sampleSize]
+	}
+
+	var bytesRead int64
+	readChunkAt := func(offset int64) error {
+		n, err := file.ReadAt(buf, offset)
+		if n > 0 {
+			h.Write(buf[:n])
+			bytesRead += int64(n)
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+		return nil
+	}
+
+	if size > 3*sampleSize {
+		if err := readChunkAt(0); err != nil {
+			return "", 0, err
+		}
+		if err := readChunkAt(size/2 - sampleSize/2); err != nil {
+			return "", 0, err
+		}
+		if err := readChunkAt(size - sampleSize); err != nil {
+			return "", 0, err
+		}
+	} else {
+		if err := readChunkAt(0); err != nil {
+			return "", 0, err
+		}
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil)), bytesRead, nil
+}
+
+// fullHash computes the hash of the complete file contents using hasher.
+func fullHash(path string, pool *sync.Pool, hasher Hasher) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := hasher.New()
+	if _, err := hashReader(h, file, pool); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// considerFile runs one already-stat'd file through the Phase 1 filtering
+// and identity-collapsing logic, shared by the directory-walk and
+// stdin-driven scan entry points.
+func considerFile(filePath string, info os.FileInfo, options ScanOptions, m *metrics.Metrics, identityToCandidate map[identityKey]*candidate, allCandidates *[]*candidate, zeroLengthFiles *[]string, largeFiles *[]string) {
+	if !info.Mode().IsRegular() {
+		return
+	}
+
+	if !matchesRegexFilters(filePath, options.RegExes) {
+		m.AddFilesIgnored(1)
+		return
+	}
+
+	fileSize := info.Size()
+
+	if fileSize == 0 {
+		m.AddFilesEmpty(1)
+		*zeroLengthFiles = append(*zeroLengthFiles, filePath)
+		return
+	}
+
+	if int64(options.MaxMB) > 0 && fileSize > int64(options.MaxMB)*1024*1024 {
+		log.Printf("Skipping VERY large %.2fMB file: %s\n", float64(fileSize)/(1024*1024), filePath)
+		m.AddFilesIgnored(1)
+		*largeFiles = append(*largeFiles, filePath)
+		return
+	}
+
+	if fileSize > 4*1024*1024*1024 {
+		fmt.Fprintf(os.Stderr, "Processing large (%.2f MB) file: %s\n", float64(fileSize)/(1024*1024), filePath)
+	}
+
+	m.AddFilesConsidered(1)
+	m.AddBytesConsidered(fileSize)
+
+	if dev, ino, ok := fileIdentity(info); ok {
+		key := identityKey{dev: dev, ino: ino}
+		if existing, seen := identityToCandidate[key]; seen {
+			existing.aliases = append(existing.aliases, filePath)
+			return
+		}
+		c := &candidate{path: filePath, size: fileSize, modTime: info.ModTime()}
+		identityToCandidate[key] = c
+		*allCandidates = append(*allCandidates, c)
+		return
+	}
+
+	*allCandidates = append(*allCandidates, &candidate{path: filePath, size: fileSize, modTime: info.ModTime()})
+}
+
+// finishBucketing turns the accumulated candidates of a Phase 1 pass into
+// the (size -> candidates) map and alias-group list the rest of the
+// pipeline expects, and records how many were eliminated as unique by size
+// alone.
+func finishBucketing(allCandidates []*candidate, m *metrics.Metrics) (map[int64][]candidate, []aliasGroup) {
+	bySize := make(map[int64][]candidate)
+	var aliasGroups []aliasGroup
+	for _, c := range allCandidates {
+		bySize[c.size] = append(bySize[c.size], *c)
+		if len(c.aliases) > 0 {
+			aliasGroups = append(aliasGroups, aliasGroup{Canonical: c.path, Aliases: c.aliases})
+		}
+	}
+
+	for _, members := range bySize {
+		if len(members) == 1 {
+			m.AddEliminatedBySize(1)
+		}
+	}
+
+	return bySize, aliasGroups
+}
+
+// splitNullOrNewline is a bufio.SplitFunc that treats either a NUL or a
+// newline byte as a path separator, so bucketBySizeFromPaths accepts both
+// newline-delimited and NUL-delimited input without needing to detect the
+// format up front.
+func splitNullOrNewline(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	for i, b := range data {
+		if b == '\n' || b == 0 {
+			return i + 1, data[:i], nil
+		}
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// bucketBySizeFromPaths reads newline- or NUL-delimited file paths from r,
+// one at a time, and runs them through the same Phase 1 filtering and
+// identity-collapsing logic as bucketBySize, without ever buffering the
+// full path list in memory.
+func bucketBySizeFromPaths(r io.Reader, options ScanOptions) (map[int64][]candidate, []string, []string, []aliasGroup) {
+	startTime := time.Now()
+
+	m := options.Metrics
+	if m == nil {
+		m = metrics.New()
+	}
+
+	zeroLengthFiles := make([]string, 0, 100)
+	largeFiles := make([]string, 0, 100)
+	identityToCandidate := make(map[identityKey]*candidate)
+	var allCandidates []*candidate
+	count := 0
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	scanner.Split(splitNullOrNewline)
+
+	for scanner.Scan() {
+		filePath := scanner.Text()
+		if filePath == "" {
+			continue
+		}
+
+		info, err := os.Lstat(filePath)
+		if err != nil {
+			log.Printf("Error accessing file: %s\nError: %s\n", filePath, err.Error())
+			continue
+		}
+
+		count++
+		if options.Detail > 0 && count%options.Detail == 0 {
+			log.Printf("Processed %d files from stdin.\t%s\r", count, filePath)
+		}
+
+		considerFile(filePath, info, options, m, identityToCandidate, &allCandidates, &zeroLengthFiles, &largeFiles)
+	}
+	if err := scanner.Err(); err != nil {
+		log.Printf("Error reading paths from stdin: %s\n", err.Error())
+	}
+
+	bySize, aliasGroups := finishBucketing(allCandidates, m)
+
+	m.RecordPhase("stdin-read", time.Since(startTime))
+
+	return bySize, zeroLengthFiles, largeFiles, aliasGroups
+}
+
+// bucketBySize walks path and groups regular files by size, splitting off
+// zero-length and oversize files along the way. Size buckets with a single
+// member are unique; they stay in the returned map and bucketBySample skips
+// them without opening the file.
+// Physical files that are already hardlinked together (same device+inode)
+// are collapsed into a single candidate so they're never rehashed as if
+// they were independent duplicates; see identityToCandidate.
+func bucketBySize(path string, options ScanOptions, totalCount int) (map[int64][]candidate, []string, []string, []aliasGroup) {
+	startTime := time.Now()
+
+	m := options.Metrics
+	if m == nil {
+		m = metrics.New()
+	}
+
+	zeroLengthFiles := make([]string, 0, 100)
+	largeFiles := make([]string, 0, 100)
+	identityToCandidate := make(map[identityKey]*candidate)
+	var allCandidates []*candidate
+	count := 0
+
+	err := filepath.Walk(path, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			log.Printf("Error accessing file: %s\n", filePath)
+			log.Printf("Error: %s\n", err.Error())
+			return nil
+		}
+
+		if info.Mode().IsRegular() {
+			count++
+			if options.Detail > 0 && count%options.Detail == 0 {
+				if totalCount > 0 {
+					percentComplete := float64(count) / float64(totalCount) * 100
+					log.Printf("Processed %d of %d files (%.2f%%).\t%s\r", count, totalCount, percentComplete, filepath.Dir(filePath))
+				} else {
+					log.Printf("Processed %d files.\t%s\r", count, filepath.Dir(filePath))
+				}
+			}
+		}
+
+		considerFile(filePath, info, options, m, identityToCandidate, &allCandidates, &zeroLengthFiles, &largeFiles)
+
+		return nil
+	})
+
+	if err != nil {
+		log.Printf("Error scanning files: %s\n", err.Error())
+	}
+
+	bySize, aliasGroups := finishBucketing(allCandidates, m)
+
+	m.RecordPhase("walk", time.Since(startTime))
+
+	return bySize, zeroLengthFiles, largeFiles, aliasGroups
+}
+
+// bucketBySample takes size buckets with at least two members and groups
+// their contents by (size, sample hash), dropping members whose sample
+// turns out to be unique within their size bucket.
+func bucketBySample(bySize map[int64][]candidate, options ScanOptions) map[string][]candidate {
+	startTime := time.Now()
+
+	m := options.Metrics
+	if m == nil {
+		m = metrics.New()
+	}
+
+	sampleSize := options.SampleSize
+	if sampleSize <= 0 {
+		sampleSize = DefaultSampleSize
+	}
+
+	bySample := make(map[string][]candidate)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	queue := make(chan struct{}, options.MaxQueueLength)
+
+	// The sample buffer only ever needs to hold one sampleSize-sized chunk,
+	// not a full defaultBufferSize read buffer like the full-hash phase
+	// uses; sizing it any larger would defeat the point of sampling small
+	// reads on a tree dominated by unique files.
+	pool := newBufferPool(int(sampleSize))
+
+	for _, members := range bySize {
+		if len(members) < 2 {
+			continue
+		}
+
+		for _, c := range members {
+			wg.Add(1)
+			queue <- struct{}{}
+
+			go func(c candidate) {
+				defer wg.Done()
+				defer func() { <-queue }()
+
+				h, bytesRead, err := sampleHash(c.path, c.size, sampleSize, pool, options.Hasher)
+				if err != nil {
+					log.Printf("\nError sampling file: %s\nException: %s\n", c.path, err.Error())
+					return
+				}
+
+				m.AddBytesHashed(bytesRead)
+
+				key := fmt.Sprintf("%d:%s", c.size, h)
+				mu.Lock()
+				bySample[key] = append(bySample[key], c)
+				mu.Unlock()
+			}(c)
+		}
+	}
+
+	wg.Wait()
+
+	for key, members := range bySample {
+		if len(members) == 1 {
+			m.AddEliminatedBySample(1)
+		}
+		if len(members) < 2 {
+			delete(bySample, key)
+		}
+	}
+
+	m.RecordPhase("sample-hash", time.Since(startTime))
+
+	return bySample
+}
+
+// bucketByFullHash computes a full content hash for every candidate that
+// survived sampling and returns the final duplicate groups keyed
+// "<size>:<hash algorithm>:<hash>".
+func bucketByFullHash(bySample map[string][]candidate, options ScanOptions) (map[string][]map[string]interface{}, map[string]bool) {
+	startTime := time.Now()
+
+	m := options.Metrics
+	if m == nil {
+		m = metrics.New()
+	}
+
+	fileDict := make(map[string][]map[string]interface{})
+	duplicateList := make(map[string]bool)
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	queue := make(chan struct{}, options.MaxQueueLength)
+	pool := newBufferPool(defaultBufferSize)
+
+	for _, members := range bySample {
+		for _, c := range members {
+			wg.Add(1)
+			queue <- struct{}{}
+
+			go func(c candidate) {
+				defer wg.Done()
+				defer func() { <-queue }()
+
+				startTime := time.Now()
+				fileHash, err := fullHash(c.path, pool, options.Hasher)
+				if err != nil {
+					log.Printf("\nError processing file: %s\nException: %s\n", c.path, err.Error())
+					return
+				}
+				elapsedTime := time.Since(startTime)
+
+				if c.size > 4*1024*1024*1024 {
+					log.Printf("File processed in %s\n\n", elapsedTime)
+				}
+
+				m.AddBytesHashed(c.size)
+
+				key := fmt.Sprintf("%d:%s:%s", c.size, options.Hasher.Name(), fileHash)
+				fileInfo := map[string]interface{}{
+					"name":      c.path,
+					"size":      c.size,
+					"hash":      fileHash,
+					"hash_algo": options.Hasher.Name(),
+					"key":       key,
+					"mtime":     c.modTime,
+					"aliases":   c.aliases,
+				}
+
+				mu.Lock()
+				defer mu.Unlock()
+
+				if _, ok := fileDict[key]; ok {
+					fileDict[key] = append(fileDict[key], fileInfo)
+					duplicateList[key] = true
+				} else {
+					fileDict[key] = []map[string]interface{}{fileInfo}
+				}
+			}(c)
+		}
+	}
+
+	wg.Wait()
+
+	for key, members := range fileDict {
+		if len(members) == 1 {
+			m.AddEliminatedByHash(1)
+			continue
+		}
+		if duplicateList[key] {
+			size := members[0]["size"].(int64)
+			m.AddRedundantBytes(size * int64(len(members)-1))
+		}
+	}
+
+	m.RecordPhase("full-hash", time.Since(startTime))
+
+	return fileDict, duplicateList
+}
+
+// scanFiles runs the full size -> sample -> full-hash pipeline over path and
+// returns a dictionary of files keyed by "<size>:<hash algorithm>:<hash>",
+// the subset of keys with more
+// than one member, zero-length files, oversize files, and any groups of
+// paths that are already hardlinked together (same device+inode) rather
+// than separate duplicate copies.
+func scanFiles(path string, options ScanOptions, totalCount int) (map[string][]map[string]interface{}, map[string]bool, []string, []string, []aliasGroup) {
+	bySize, zeroLengthFiles, largeFiles, aliasGroups := bucketBySize(path, options, totalCount)
+	return finishScan(bySize, zeroLengthFiles, largeFiles, aliasGroups, options)
+}
+
+// scanFilesFromStdin runs the same size -> sample -> full-hash pipeline as
+// scanFiles, but over a stream of paths read from r instead of a directory
+// walk, so it can be fed by an arbitrary UNIX file-selection command.
+func scanFilesFromStdin(r io.Reader, options ScanOptions) (map[string][]map[string]interface{}, map[string]bool, []string, []string, []aliasGroup) {
+	bySize, zeroLengthFiles, largeFiles, aliasGroups := bucketBySizeFromPaths(r, options)
+	return finishScan(bySize, zeroLengthFiles, largeFiles, aliasGroups, options)
+}
+
+// finishScan runs Phase 2 and Phase 3 over a Phase 1 result, shared by
+// scanFiles and scanFilesFromStdin.
+func finishScan(bySize map[int64][]candidate, zeroLengthFiles, largeFiles []string, aliasGroups []aliasGroup, options ScanOptions) (map[string][]map[string]interface{}, map[string]bool, []string, []string, []aliasGroup) {
+	bySample := bucketBySample(bySize, options)
+	fileDict, duplicateList := bucketByFullHash(bySample, options)
+
+	return fileDict, duplicateList, zeroLengthFiles, largeFiles, aliasGroups
+}
+
+func countFiles(path string, options ScanOptions) (int, error) {
+	count := 0
+	detail := options.Detail
+	totalCount := 0
+
+	err := filepath.Walk(path, func(filePath string, info os.FileInfo, err error) error {
+		// Make errors non-fatal in counting mode
+		if err != nil {
+			log.Printf("Error accessing file: %s\nError: %s\n", filePath, err.Error())
+			return nil
+		}
+
+		if info.Mode().IsRegular() {
+			totalCount++
+
+			if detail > 0 && totalCount%detail == 0 {
+				log.Printf("Counted %d files of which %d matched a regex.\n Currently in dir %s.\n",
+					totalCount, count, filepath.Dir(filePath))
+			}
+
+			if matchesRegexFilters(filePath, options.RegExes) {
+				count++
+			}
+		}
+		return nil
+	})
+	return count, err
+}
@@ -0,0 +1,92 @@
+package main
+
+// verify.go implements an optional byte-by-byte verification pass that
+// re-checks a hash-confirmed duplicate group before any destructive action
+// is taken on it, eliminating the residual risk of a hash collision.
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"os"
+)
+
+const verifyBufferSize = 4 * 1024 * 1024
+
+// filesEqual streams a and b in lockstep and compares them chunk by chunk,
+// short-circuiting on the first mismatch.
+func filesEqual(pathA, pathB string) (bool, error) {
+	fa, err := os.Open(pathA)
+	if err != nil {
+		return false, err
+	}
+	defer fa.Close()
+
+	fb, err := os.Open(pathB)
+	if err != nil {
+		return false, err
+	}
+	defer fb.Close()
+
+	bufA := make([]byte, verifyBufferSize)
+	bufB := make([]byte, verifyBufferSize)
+
+	for {
+		nA, errA := io.ReadFull(fa, bufA)
+		nB, errB := io.ReadFull(fb, bufB)
+
+		if nA != nB || !bytes.Equal(bufA[:nA], bufB[:nB]) {
+			return false, nil
+		}
+
+		doneA := errA == io.EOF || errA == io.ErrUnexpectedEOF
+		doneB := errB == io.EOF || errB == io.ErrUnexpectedEOF
+		if doneA != doneB {
+			return false, nil
+		}
+		if doneA {
+			return true, nil
+		}
+		if errA != nil {
+			return false, errA
+		}
+		if errB != nil {
+			return false, errB
+		}
+	}
+}
+
+// verifyDuplicateGroup re-checks a hash-confirmed duplicate group with a
+// byte-by-byte compare of every member against the canonical file. Members
+// that don't actually match byte-for-byte (a hash collision) are dropped
+// from the group with a loud warning instead of being silently acted on.
+func verifyDuplicateGroup(dupeFiles []map[string]interface{}) []map[string]interface{} {
+	canonical := pickCanonical(dupeFiles)
+	if canonical == nil {
+		return dupeFiles
+	}
+	canonicalPath := canonical["name"].(string)
+
+	verified := make([]map[string]interface{}, 0, len(dupeFiles))
+	for _, file := range dupeFiles {
+		path := file["name"].(string)
+		if path == canonicalPath {
+			verified = append(verified, file)
+			continue
+		}
+
+		equal, err := filesEqual(canonicalPath, path)
+		if err != nil {
+			log.Printf("error verifying %s against %s: %s\n", path, canonicalPath, err.Error())
+			continue
+		}
+		if !equal {
+			log.Printf("HASH COLLISION: %s does not match %s byte-for-byte; excluding from duplicate group\n", path, canonicalPath)
+			continue
+		}
+
+		verified = append(verified, file)
+	}
+
+	return verified
+}